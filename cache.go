@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// errCacheMiss is returned by fetch in -cache-only mode when a URL hasn't
+// been fetched in a prior crawl.
+var errCacheMiss = errors.New("cache: no entry for URL (-cache-only)")
+
+var (
+	crawlBucket = []byte("crawl") // canonical URL -> crawlRecord (JSON)
+	metaBucket  = []byte("meta")  // "seed" -> the seed URL of the last crawl
+	seedKey     = []byte("seed")
+)
+
+// crawlRecord is what pageCache persists per canonical URL: fetched page
+// content/metadata once Visited, or just frontier placement (Depth) while
+// it's still pending. Keeping both in one record lets a resumed crawl seed
+// its frontier straight from whatever the cache already has on disk.
+type crawlRecord struct {
+	Depth        int       `json:"depth"`
+	Parent       string    `json:"parent,omitempty"`
+	Visited      bool      `json:"visited"`
+	Status       int       `json:"status,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Body         []byte    `json:"body,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at,omitempty"`
+}
+
+func (r crawlRecord) toResult(url string) fetchResult {
+	return fetchResult{
+		url:          url,
+		status:       r.Status,
+		contentType:  r.ContentType,
+		body:         r.Body,
+		etag:         r.ETag,
+		lastModified: r.LastModified,
+		fetchedAt:    r.FetchedAt,
+	}
+}
+
+// pageCache persists per-URL crawl state in an embedded bbolt store, so an
+// interrupted crawl can resume its frontier and re-runs can issue
+// conditional GETs instead of re-downloading unchanged pages. A nil
+// *pageCache is valid and behaves as "caching disabled".
+type pageCache struct {
+	db *bolt.DB
+}
+
+func openCache(dir string) (*pageCache, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating cache dir %q: %w", dir, err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "crawl.db"), 0o644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening cache at %q: %w", dir, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(crawlBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(metaBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing cache buckets: %w", err)
+	}
+	return &pageCache{db: db}, nil
+}
+
+func (pc *pageCache) close() error {
+	if pc == nil {
+		return nil
+	}
+	return pc.db.Close()
+}
+
+func (pc *pageCache) get(url string) (crawlRecord, bool) {
+	var rec crawlRecord
+	if pc == nil {
+		return rec, false
+	}
+	found := false
+	pc.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(crawlBucket).Get([]byte(url))
+		if v == nil {
+			return nil
+		}
+		found = json.Unmarshal(v, &rec) == nil
+		return nil
+	})
+	return rec, found
+}
+
+func (pc *pageCache) put(url string, rec crawlRecord) {
+	if pc == nil {
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	pc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(crawlBucket).Put([]byte(url), data)
+	})
+}
+
+// priorSeed returns the seed URL of whatever crawl last populated this
+// cache directory, or "" if the cache is empty/fresh.
+func (pc *pageCache) priorSeed() string {
+	if pc == nil {
+		return ""
+	}
+	var seed string
+	pc.db.View(func(tx *bolt.Tx) error {
+		seed = string(tx.Bucket(metaBucket).Get(seedKey))
+		return nil
+	})
+	return seed
+}
+
+func (pc *pageCache) setSeed(seed string) {
+	if pc == nil {
+		return
+	}
+	pc.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(seedKey, []byte(seed))
+	})
+}
+
+// pendingFrontier returns the URLs a prior, interrupted crawl had
+// discovered but not yet fetched, so the new crawl can pick up where it left off.
+func (pc *pageCache) pendingFrontier() []fetchJob {
+	if pc == nil {
+		return nil
+	}
+	var pending []fetchJob
+	pc.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(crawlBucket).ForEach(func(k, v []byte) error {
+			var rec crawlRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return nil
+			}
+			if !rec.Visited {
+				pending = append(pending, fetchJob{url: string(k), depth: rec.Depth, parent: rec.Parent})
+			}
+			return nil
+		})
+	})
+	return pending
+}
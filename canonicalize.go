@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultStripParams lists tracking query params canonicalize always
+// strips, in addition to anything passed via -strip-params. utm_* is
+// handled separately via a prefix match.
+var defaultStripParams = []string{"fbclid", "gclid"}
+
+// canonicalizeOpts are the knobs canonicalize needs, parsed once from flags
+// rather than re-parsed on every call.
+type canonicalizeOpts struct {
+	stripTrailingSlash bool
+	stripParams        []string
+}
+
+// canonicalize normalizes rawURL so equivalent URLs collapse to the same
+// seen-set entry -- explicitly called out as a bug in the original BFS:
+// www.google.com/ and www.google.com used to be treated as two different
+// pages. It lowercases scheme/host, strips default ports, drops the
+// fragment, collapses "//" and resolves "."/".." in the path, sorts query
+// params and strips tracking ones, and optionally trims a trailing slash.
+func canonicalize(rawURL string, opts canonicalizeOpts) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = stripDefaultPort(u.Scheme, strings.ToLower(u.Host))
+	u.Fragment = ""
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Path = cleanPath(u.Path)
+	if opts.stripTrailingSlash && u.Path != "/" && strings.HasSuffix(u.Path, "/") {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+	}
+
+	u.RawQuery = canonicalizeQuery(u.Query(), opts.stripParams)
+
+	return u.String()
+}
+
+// stripDefaultPort removes a redundant ":80" (http) or ":443" (https) from host.
+func stripDefaultPort(scheme, host string) string {
+	switch {
+	case scheme == "http" && strings.HasSuffix(host, ":80"):
+		return strings.TrimSuffix(host, ":80")
+	case scheme == "https" && strings.HasSuffix(host, ":443"):
+		return strings.TrimSuffix(host, ":443")
+	default:
+		return host
+	}
+}
+
+// cleanPath collapses repeated slashes and resolves "." / ".." segments,
+// restoring a trailing slash that path.Clean would otherwise drop.
+func cleanPath(p string) string {
+	if p == "" {
+		return p
+	}
+	for strings.Contains(p, "//") {
+		p = strings.ReplaceAll(p, "//", "/")
+	}
+	cleaned := path.Clean(p)
+	if cleaned == "." {
+		return "/"
+	}
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(cleaned, "/") {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// canonicalizeQuery strips tracking params and returns the remaining params
+// sorted by key so that differently-ordered equivalent query strings collapse.
+func canonicalizeQuery(q url.Values, extraStrip []string) string {
+	strip := append(append([]string{}, defaultStripParams...), extraStrip...)
+	for key := range q {
+		if shouldStrip(key, strip) {
+			q.Del(key)
+		}
+	}
+	if len(q) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range q[k] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(k))
+			b.WriteByte('=')
+			b.WriteString(url.QueryEscape(v))
+		}
+	}
+	return b.String()
+}
+
+// splitNonEmpty splits a comma-separated flag value, dropping empty entries
+// so an unset flag yields a nil slice instead of [""].
+func splitNonEmpty(csv string) []string {
+	var out []string
+	for _, s := range strings.Split(csv, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func shouldStrip(key string, strip []string) bool {
+	if strings.HasPrefix(key, "utm_") {
+		return true
+	}
+	for _, p := range strip {
+		if key == p {
+			return true
+		}
+	}
+	return false
+}
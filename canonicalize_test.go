@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		opts canonicalizeOpts
+		want string
+	}{
+		{
+			name: "apex with and without trailing slash collapse",
+			in:   "https://www.google.com",
+			want: "https://www.google.com/",
+		},
+		{
+			name: "apex already has trailing slash",
+			in:   "https://www.google.com/",
+			want: "https://www.google.com/",
+		},
+		{
+			name: "scheme and host are lowercased",
+			in:   "HTTPS://WWW.Example.COM/Path",
+			want: "https://www.example.com/Path",
+		},
+		{
+			name: "default port stripped",
+			in:   "https://example.com:443/",
+			want: "https://example.com/",
+		},
+		{
+			name: "fragment dropped",
+			in:   "https://example.com/page#section",
+			want: "https://example.com/page",
+		},
+		{
+			name: "repeated slashes and dot segments collapsed",
+			in:   "https://example.com/a//b/./c/../d",
+			want: "https://example.com/a/b/d",
+		},
+		{
+			name: "tracking params stripped and remaining sorted",
+			in:   "https://example.com/?utm_source=x&b=2&a=1&fbclid=y",
+			want: "https://example.com/?a=1&b=2",
+		},
+		{
+			name: "stripTrailingSlash trims non-root path",
+			in:   "https://example.com/path/",
+			opts: canonicalizeOpts{stripTrailingSlash: true},
+			want: "https://example.com/path",
+		},
+		{
+			name: "stripTrailingSlash never empties the root path",
+			in:   "https://example.com/",
+			opts: canonicalizeOpts{stripTrailingSlash: true},
+			want: "https://example.com/",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := canonicalize(c.in, c.opts); got != c.want {
+				t.Errorf("canonicalize(%q, %+v) = %q, want %q", c.in, c.opts, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PhamJamStudio/link"
+	"golang.org/x/time/rate"
+)
+
+// fetchResult is a fetched page's content plus the response metadata
+// (status, content type, caching headers, fetch time) that both the page
+// cache and the eventual sitemap output need.
+type fetchResult struct {
+	url          string // final URL after redirects
+	status       int
+	contentType  string
+	body         []byte
+	etag         string
+	lastModified string
+	fetchedAt    time.Time
+}
+
+// maxRetries bounds the exponential backoff retry loop for transient fetch errors.
+const maxRetries = 3
+
+// fetchJob is a single unit of crawl work: a URL discovered at a given BFS depth.
+// Carrying depth on the job itself means the frontier can be a single FIFO
+// queue instead of swapping a "current" and "next" queue between levels.
+type fetchJob struct {
+	url    string
+	depth  int
+	parent string // "" for the seed URL
+}
+
+// jobFrontier is an unbounded, concurrency-safe FIFO queue of fetchJobs.
+// bfs used to hand jobs to workers over a fixed-size buffered channel, but a
+// worker fanning out more links than fit in the remaining buffer would block
+// on the send with every other worker doing the same -- a livelock with no
+// worker left to drain the channel. Backing the frontier with a growable
+// slice instead means push from inside a worker never blocks.
+type jobFrontier struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []fetchJob
+	closed bool
+}
+
+func newJobFrontier() *jobFrontier {
+	f := &jobFrontier{}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// push appends job to the frontier. Never blocks.
+func (f *jobFrontier) push(job fetchJob) {
+	f.mu.Lock()
+	f.queue = append(f.queue, job)
+	f.mu.Unlock()
+	f.cond.Signal()
+}
+
+// pop blocks until a job is available or the frontier has been closed with
+// nothing left in it, in which case it returns ok == false.
+func (f *jobFrontier) pop() (job fetchJob, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.queue) == 0 && !f.closed {
+		f.cond.Wait()
+	}
+	if len(f.queue) == 0 {
+		return fetchJob{}, false
+	}
+	job, f.queue = f.queue[0], f.queue[1:]
+	return job, true
+}
+
+// close wakes every goroutine blocked in pop so they can observe there's no
+// more work left.
+func (f *jobFrontier) close() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// crawler holds everything shared across worker goroutines: the HTTP client,
+// per-host rate limiters, the robots.txt cache, and the seen-set used to
+// dedupe the frontier.
+type crawler struct {
+	numWorkers        int
+	client            *http.Client
+	userAgent         string
+	ignoreRobots      bool
+	maxBodyBytes      int64
+	includeSubdomains bool
+	canonOpts         canonicalizeOpts
+	cache             *pageCache
+	cacheOnly         bool
+
+	// siteFilter is anchored on the seed URL's host; set once at the start
+	// of bfs and shared read-only by every worker thereafter.
+	siteFilter func(string) bool
+
+	robots *robotsCache
+
+	limMu    sync.Mutex
+	limiters map[string]*rate.Limiter
+	qps      rate.Limit
+
+	seenMu sync.Mutex
+	seen   map[string]struct{}
+}
+
+func newCrawler(workers int, qps float64, timeout time.Duration, userAgent string, ignoreRobots bool, maxBodyBytes int64, includeSubdomains bool, canonOpts canonicalizeOpts, cache *pageCache, cacheOnly bool) *crawler {
+	if workers < 1 {
+		workers = 1
+	}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	return &crawler{
+		numWorkers:        workers,
+		client:            client,
+		userAgent:         userAgent,
+		ignoreRobots:      ignoreRobots,
+		maxBodyBytes:      maxBodyBytes,
+		includeSubdomains: includeSubdomains,
+		canonOpts:         canonOpts,
+		cache:             cache,
+		cacheOnly:         cacheOnly,
+		robots:            newRobotsCache(client, userAgent),
+		limiters:          make(map[string]*rate.Limiter),
+		qps:               rate.Limit(qps),
+		seen:              make(map[string]struct{}),
+	}
+}
+
+// limiterFor returns the per-host rate limiter, creating one on first use.
+func (c *crawler) limiterFor(host string) *rate.Limiter {
+	c.limMu.Lock()
+	defer c.limMu.Unlock()
+	lim, ok := c.limiters[host]
+	if !ok {
+		lim = rate.NewLimiter(c.qps, 1)
+		c.limiters[host] = lim
+	}
+	return lim
+}
+
+// applyCrawlDelay slows a host's limiter down to honor a robots.txt
+// Crawl-delay, but never speeds it up past the configured -qps.
+func (c *crawler) applyCrawlDelay(host string, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	lim := c.limiterFor(host)
+	if want := rate.Limit(1 / delay.Seconds()); want < lim.Limit() {
+		lim.SetLimit(want)
+	}
+}
+
+// markSeen reports whether urlStr was newly added to the seen-set.
+func (c *crawler) markSeen(urlStr string) bool {
+	c.seenMu.Lock()
+	defer c.seenMu.Unlock()
+	if _, ok := c.seen[urlStr]; ok {
+		return false
+	}
+	c.seen[urlStr] = struct{}{}
+	return true
+}
+
+// bfs fans fetches out across a pool of workers instead of walking depth
+// levels serially. The frontier is an unbounded jobFrontier of fetchJobs
+// carrying (url, depth); a shared seen-set (guarded by seenMu) keeps the
+// same URL from being enqueued twice, and an atomic in-flight counter
+// detects when there's no work left so the frontier can be closed and the
+// workers can exit.
+func (c *crawler) bfs(urlStr string, maxDepth int) []page {
+	urlStr = canonicalize(urlStr, c.canonOpts)
+	seed, err := url.Parse(urlStr)
+	if err != nil {
+		log.Println("ERROR: parsing seed URL:", err)
+		return nil
+	}
+	c.siteFilter = sameSite(seed.Host, c.includeSubdomains)
+
+	jobs := newJobFrontier()
+	// inFlight starts at 1, a placeholder for "bfs is still seeding the
+	// initial batch", so the close-on-zero protocol below can't fire while
+	// the resume/seed enqueue calls are still in progress -- otherwise a
+	// job with no children finishing between two of those calls could hit
+	// zero and close the frontier before the next one is even pushed.
+	var inFlight int64 = 1
+
+	var resMu sync.Mutex
+	var results []page
+
+	// enqueue canonicalizes u before it ever touches the seen-set or the
+	// frontier, so e.g. www.google.com/ and www.google.com collapse to one entry.
+	enqueue := func(u string, depth int, parent string) {
+		u = canonicalize(u, c.canonOpts)
+		if !c.markSeen(u) {
+			return
+		}
+		if _, cached := c.cache.get(u); !cached {
+			c.cache.put(u, crawlRecord{Depth: depth, Parent: parent})
+		}
+		atomic.AddInt64(&inFlight, 1)
+		jobs.push(fetchJob{url: u, depth: depth, parent: parent})
+	}
+
+	var workerWG sync.WaitGroup
+	workerWG.Add(c.numWorkers)
+	for i := 0; i < c.numWorkers; i++ {
+		go func() {
+			defer workerWG.Done()
+			for {
+				job, ok := jobs.pop()
+				if !ok {
+					return
+				}
+				c.process(job, maxDepth, enqueue, &resMu, &results)
+				if atomic.AddInt64(&inFlight, -1) == 0 {
+					jobs.close()
+				}
+			}
+		}()
+	}
+
+	// Resume: if the cache holds a prior, interrupted crawl of this same
+	// seed, pick up its frontier instead of starting over from scratch.
+	if c.cache.priorSeed() == urlStr {
+		for _, job := range c.cache.pendingFrontier() {
+			enqueue(job.url, job.depth, job.parent)
+		}
+	}
+	c.cache.setSeed(urlStr)
+
+	enqueue(urlStr, 0, "")
+
+	// Seeding is done; release the placeholder slot and let the
+	// close-on-zero protocol take over from here.
+	if atomic.AddInt64(&inFlight, -1) == 0 {
+		jobs.close()
+	}
+	workerWG.Wait()
+
+	return results
+}
+
+// process fetches a single job's page, records it (URL, depth, parent edge,
+// and response metadata) and enqueues its same-domain children, provided we
+// haven't hit maxDepth.
+func (c *crawler) process(job fetchJob, maxDepth int, enqueue func(string, int, string), resMu *sync.Mutex, results *[]page) {
+	fmt.Println("URL found:", job.url)
+
+	res, links, err := c.getDomainPages(job.url, job.depth)
+	if errors.Is(err, errDisallowed) || errors.Is(err, errUnwantedContent) {
+		return
+	}
+	if errors.Is(err, errCacheMiss) {
+		log.Println("cache miss (-cache-only):", job.url)
+		return
+	}
+	if err != nil {
+		log.Println("ERROR:", err)
+		return
+	}
+
+	resMu.Lock()
+	*results = append(*results, page{
+		URL:          job.url,
+		Depth:        job.depth,
+		Parent:       job.parent,
+		Status:       res.status,
+		ContentType:  res.contentType,
+		FetchedAt:    res.fetchedAt,
+		LastModified: res.lastModified,
+	})
+	resMu.Unlock()
+
+	if job.depth >= maxDepth {
+		return
+	}
+	for _, link := range filterURLs(links, c.siteFilter) {
+		enqueue(link, job.depth+1, job.url)
+	}
+}
+
+// Given a URL, DL HTML (through the shared, rate-limited, cache-aware
+// fetch), get domain, return every absolute or root-relative link on the
+// page. No same-site filtering happens here; process applies c.siteFilter.
+func (c *crawler) getDomainPages(urlStr string, depth int) (fetchResult, []string, error) {
+	res, err := c.fetch(urlStr, depth)
+	if err != nil {
+		return fetchResult{}, nil, err
+	}
+
+	u, err := url.Parse(res.url)
+	if err != nil {
+		return fetchResult{}, nil, fmt.Errorf("parsing %q: %w", res.url, err)
+	}
+	// Build proper urls w/ our links i.e. add scheme (http, https, ftp, etc) + host = domain, ignore mailto, different domains
+	base := getDomain(u)
+	links, err := getURLs(bytes.NewReader(res.body), base)
+	if err != nil {
+		return fetchResult{}, nil, err
+	}
+	return res, links, nil
+}
+
+// checkRobots honors robots.txt Disallow/Crawl-delay directives unless
+// -ignore-robots was set.
+func (c *crawler) checkRobots(urlStr string) error {
+	if c.ignoreRobots {
+		return nil
+	}
+	allowed, delay := c.robots.allowed(urlStr)
+	if !allowed {
+		return errDisallowed
+	}
+	if u, err := url.Parse(urlStr); err == nil {
+		c.applyCrawlDelay(u.Host, delay)
+	}
+	return nil
+}
+
+// precheck issues a HEAD request and skips URLs whose Content-Type isn't
+// text/html or whose Content-Length exceeds maxBodyBytes, so we never pay
+// for downloading PDFs, images, or giant pages we can't parse links from.
+// The HEAD goes through the same per-host limiter as the GET in fetch, so
+// it counts against -qps and honors any robots.txt Crawl-delay too.
+func (c *crawler) precheck(urlStr string) error {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return fmt.Errorf("parsing %q: %w", urlStr, err)
+	}
+	if err := c.limiterFor(u.Host).Wait(context.Background()); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodHead, urlStr, nil)
+	if err != nil {
+		return fmt.Errorf("building HEAD request for %q: %w", urlStr, err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// Some servers don't support HEAD; fall through and let the real GET decide.
+		return nil
+	}
+	resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "text/html") {
+		return errUnwantedContent
+	}
+	if c.maxBodyBytes > 0 && resp.ContentLength > c.maxBodyBytes {
+		return errUnwantedContent
+	}
+	return nil
+}
+
+// readBody reads r fully, but returns errUnwantedContent instead of a huge
+// body when maxBodyBytes > 0. precheck's Content-Length check is only
+// advisory -- chunked responses report no length, and servers without HEAD
+// support skip it entirely -- so this is the hard limit the request asked for.
+func readBody(r io.Reader, maxBodyBytes int64) ([]byte, error) {
+	if maxBodyBytes <= 0 {
+		return io.ReadAll(r)
+	}
+	body, err := io.ReadAll(io.LimitReader(r, maxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBodyBytes {
+		return nil, errUnwantedContent
+	}
+	return body, nil
+}
+
+// fetch performs a rate-limited GET with exponential backoff retries on
+// transient network errors and 5xx responses. In -cache-only mode it never
+// touches the network: it serves the page from a prior crawl or returns
+// errCacheMiss. Otherwise it issues a conditional GET (If-None-Match /
+// If-Modified-Since) when the cache already has an ETag/Last-Modified for
+// this URL, and persists the result either way so future runs can do the same.
+func (c *crawler) fetch(urlStr string, depth int) (fetchResult, error) {
+	cached, hasCached := c.cache.get(urlStr)
+	if c.cacheOnly {
+		if !hasCached || !cached.Visited {
+			return fetchResult{}, errCacheMiss
+		}
+		return cached.toResult(urlStr), nil
+	}
+
+	if err := c.checkRobots(urlStr); err != nil {
+		return fetchResult{}, err
+	}
+	if err := c.precheck(urlStr); err != nil {
+		return fetchResult{}, err
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return fetchResult{}, fmt.Errorf("parsing %q: %w", urlStr, err)
+	}
+	lim := c.limiterFor(u.Host)
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if err := lim.Wait(context.Background()); err != nil {
+			return fetchResult{}, err
+		}
+
+		req, err := http.NewRequest(http.MethodGet, urlStr, nil)
+		if err != nil {
+			return fetchResult{}, fmt.Errorf("building GET request for %q: %w", urlStr, err)
+		}
+		req.Header.Set("User-Agent", c.userAgent)
+		if hasCached && cached.Visited {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			lastErr = err
+			if attempt < maxRetries {
+				backoff(attempt)
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusNotModified {
+			resp.Body.Close()
+			cached.Depth = depth
+			cached.Visited = true
+			cached.FetchedAt = time.Now()
+			c.cache.put(urlStr, cached)
+			return cached.toResult(urlStr), nil
+		}
+		if resp.StatusCode >= 500 {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("%s: %s", urlStr, resp.Status)
+			if attempt < maxRetries {
+				backoff(attempt)
+			}
+			continue
+		}
+
+		body, err := readBody(resp.Body, c.maxBodyBytes)
+		resp.Body.Close()
+		if errors.Is(err, errUnwantedContent) {
+			return fetchResult{}, err
+		}
+		if err != nil {
+			return fetchResult{}, fmt.Errorf("reading body of %q: %w", urlStr, err)
+		}
+
+		result := fetchResult{
+			url:          resp.Request.URL.String(),
+			status:       resp.StatusCode,
+			contentType:  resp.Header.Get("Content-Type"),
+			body:         body,
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+			fetchedAt:    time.Now(),
+		}
+		c.cache.put(urlStr, crawlRecord{
+			Depth:        depth,
+			Parent:       cached.Parent,
+			Visited:      true,
+			Status:       result.status,
+			ContentType:  result.contentType,
+			Body:         result.body,
+			ETag:         result.etag,
+			LastModified: result.lastModified,
+			FetchedAt:    result.fetchedAt,
+		})
+		return result, nil
+	}
+	return fetchResult{}, fmt.Errorf("giving up on %s after %d attempts: %w", urlStr, maxRetries+1, lastErr)
+}
+
+// backoff sleeps for an exponentially increasing, jittered delay before a retry.
+func backoff(attempt int) {
+	base := time.Duration(1<<uint(attempt)) * 200 * time.Millisecond
+	jitter := time.Duration(rand.Int63n(int64(base / 2)))
+	time.Sleep(base + jitter)
+}
+
+// Given a URL, return the domain e.g https://eqmac.app
+func getDomain(u *url.URL) string {
+	// url.Parse() -> u.Host doesn't include the redir url, which other links would likely use
+	baseURL := &url.URL{ // create new URL since we only need scheme/host
+		Scheme: u.Scheme, // Scheme includes ftp, http, https, etc.
+		Host:   u.Host,
+	}
+	return baseURL.String() // returns non nil fields in URL as concatenated string, here just scheme e.g HTTPS, and Host, e.g https://eqmac.app
+}
+
+// Given a http.response.body representing HTML from URL, return all URLs
+func getURLs(h io.Reader, base string) ([]string, error) {
+	// Parse all links on the page
+	links, err := link.Parse(h)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add sanitized URL's to links to return
+	var ret []string
+	for _, l := range links {
+		switch {
+		// if href doesn't include domain, add it before appending
+		case strings.HasPrefix(l.Href, "/"):
+			ret = append(ret, base+l.Href)
+		// if href starts with http, append as is, which includes https
+		case strings.HasPrefix(l.Href, "http"):
+			// TODO: Don't add dupes
+			ret = append(ret, l.Href)
+		}
+	}
+
+	return ret, nil
+}
+
+// Given a list of URLs, returned filtered list of URL's based on keepFn. which is a func w/ filter criteria
+func filterURLs(links []string, keepFn func(string) bool) []string {
+	var ret []string
+	for _, link := range links {
+		if keepFn(link) { // excludes everything not the same as base domain including mailto:, other domains
+			ret = append(ret, link)
+		}
+	}
+	return ret
+}
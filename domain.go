@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// registrableDomain returns the eTLD+1 for host using the Mozilla Public
+// Suffix List, e.g. "example.com" for "blog.example.com". Hosts that aren't
+// covered by the list (e.g. "localhost", bare IPs) are returned unchanged.
+func registrableDomain(host string) string {
+	host = strings.ToLower(host)
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if net.ParseIP(hostname) != nil {
+		return host
+	}
+	etld1, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return etld1
+}
+
+// sameSite builds a keepFn (see filterURLs) that scopes a crawl to a single
+// site, anchored on the seed URL's host rather than each page's own host.
+// That's what lets a crawl started at https://example.com/ keep links to
+// https://www.example.com/ instead of treating the two as unrelated domains.
+//
+// When includeSubdomains is false, only links with the exact seed host are
+// kept. When true, any host sharing the seed's eTLD+1 is kept (so
+// blog.example.com and www.example.com both count).
+func sameSite(seedHost string, includeSubdomains bool) func(string) bool {
+	seedHost = strings.ToLower(seedHost)
+	seedETLD1 := registrableDomain(seedHost)
+	return func(link string) bool {
+		u, err := url.Parse(link)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(u.Host)
+		if includeSubdomains {
+			return registrableDomain(host) == seedETLD1
+		}
+		return host == seedHost
+	}
+}
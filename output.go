@@ -0,0 +1,338 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const xmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type loc struct {
+	Val        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+type urlset struct {
+	Urls  []loc  `xml:"url"`
+	Xmlns string `xml:"xmlns,attr"`
+}
+
+// page is a single crawled URL plus everything learned fetching it: where
+// it was discovered from (Parent, "" for the seed), how deep it is, and the
+// response metadata every output format beyond the plain XML list wants.
+type page struct {
+	URL          string    `json:"url"`
+	Depth        int       `json:"depth"`
+	Parent       string    `json:"parent"`
+	Status       int       `json:"status"`
+	ContentType  string    `json:"content_type"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	LastModified string    `json:"-"` // raw Last-Modified response header, if any; feeds <lastmod>
+}
+
+// sitemap index limits, per https://www.sitemaps.org/protocol.html#index
+const (
+	maxURLsPerSitemap = 50000
+	maxSitemapBytes   = 50 * 1024 * 1024
+)
+
+// Output renders a completed crawl's pages in a particular format, writing
+// to outPath or to stdout when outPath is "".
+type Output interface {
+	Write(outPath string, pages []page) error
+}
+
+// writerOutput is implemented by formats that render to a single
+// io.Writer; gzipOutput wraps one of these to add on-the-fly compression.
+type writerOutput interface {
+	writeTo(w io.Writer, pages []page) error
+}
+
+// selectOutput resolves the -format flag to an Output implementation.
+// changeFreqOverride, if non-empty, forces every <changefreq> in XML-family
+// formats instead of deriving it from depth.
+func selectOutput(format, changeFreqOverride string) (Output, error) {
+	switch format {
+	case "", "xml":
+		return xmlOutput{changeFreqOverride: changeFreqOverride}, nil
+	case "xml.gz":
+		return gzipOutput{inner: xmlOutput{changeFreqOverride: changeFreqOverride}}, nil
+	case "sitemapindex":
+		return sitemapIndexOutput{changeFreqOverride: changeFreqOverride}, nil
+	case "json":
+		return jsonOutput{}, nil
+	case "csv":
+		return csvOutput{}, nil
+	case "dot":
+		return dotOutput{}, nil
+	default:
+		return nil, fmt.Errorf("unknown -format %q (want xml, xml.gz, sitemapindex, json, csv, or dot)", format)
+	}
+}
+
+// withOutput opens outPath (or stdout, if empty) and runs fn against it.
+func withOutput(outPath string, fn func(io.Writer) error) error {
+	if outPath == "" {
+		return fn(os.Stdout)
+	}
+	f, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("creating %q: %w", outPath, err)
+	}
+	defer f.Close()
+	return fn(f)
+}
+
+// xmlOutput is the spec-complete single urlset sitemap: <loc> plus
+// <lastmod>/<changefreq>/<priority> derived from each page's fetch metadata.
+type xmlOutput struct {
+	changeFreqOverride string
+}
+
+func (o xmlOutput) writeTo(w io.Writer, pages []page) error {
+	set := urlset{Urls: make([]loc, len(pages)), Xmlns: xmlns}
+	for i, p := range pages {
+		set.Urls[i] = loc{
+			Val:        p.URL,
+			LastMod:    lastMod(p).Format(time.RFC3339),
+			ChangeFreq: changeFreqForDepth(p.Depth, o.changeFreqOverride),
+			Priority:   strconv.FormatFloat(priorityForDepth(p.Depth), 'f', 1, 64),
+		}
+	}
+	if _, err := fmt.Fprint(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "   ")
+	return enc.Encode(set)
+}
+
+// lastMod is the Last-Modified response header, parsed, falling back to the
+// time the page was fetched when the header was absent or unparseable.
+func lastMod(p page) time.Time {
+	if p.LastModified != "" {
+		if t, err := http.ParseTime(p.LastModified); err == nil {
+			return t
+		}
+	}
+	return p.FetchedAt
+}
+
+// changeFreqForDepth infers <changefreq> from crawl depth: the seed changes
+// most often, direct links less so, and everything deeper is assumed
+// fairly static. -changefreq overrides this heuristic for every page.
+func changeFreqForDepth(depth int, override string) string {
+	if override != "" {
+		return override
+	}
+	switch depth {
+	case 0:
+		return "daily"
+	case 1:
+		return "weekly"
+	default:
+		return "monthly"
+	}
+}
+
+// priorityForDepth computes <priority> as max(0.1, 1.0 - 0.2*depth), so the
+// seed ranks highest and priority tapers off for deeper pages.
+func priorityForDepth(depth int) float64 {
+	p := 1.0 - 0.2*float64(depth)
+	if p < 0.1 {
+		p = 0.1
+	}
+	return p
+}
+
+func (o xmlOutput) Write(outPath string, pages []page) error {
+	return withOutput(outPath, func(w io.Writer) error { return o.writeTo(w, pages) })
+}
+
+// gzipOutput wraps another writerOutput, compressing its output on the fly.
+type gzipOutput struct {
+	inner writerOutput
+}
+
+func (o gzipOutput) Write(outPath string, pages []page) error {
+	return withOutput(outPath, func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		if err := o.inner.writeTo(gz, pages); err != nil {
+			gz.Close()
+			return err
+		}
+		return gz.Close()
+	})
+}
+
+// jsonOutput is newline-delimited JSON, one page object per line.
+type jsonOutput struct{}
+
+func (jsonOutput) writeTo(w io.Writer, pages []page) error {
+	enc := json.NewEncoder(w)
+	for _, p := range pages {
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o jsonOutput) Write(outPath string, pages []page) error {
+	return withOutput(outPath, func(w io.Writer) error { return o.writeTo(w, pages) })
+}
+
+// csvOutput writes one row per page, with a header row.
+type csvOutput struct{}
+
+func (csvOutput) writeTo(w io.Writer, pages []page) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"url", "depth", "parent", "status", "content_type", "fetched_at"}); err != nil {
+		return err
+	}
+	for _, p := range pages {
+		row := []string{
+			p.URL,
+			strconv.Itoa(p.Depth),
+			p.Parent,
+			strconv.Itoa(p.Status),
+			p.ContentType,
+			p.FetchedAt.Format(time.RFC3339),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (o csvOutput) Write(outPath string, pages []page) error {
+	return withOutput(outPath, func(w io.Writer) error { return o.writeTo(w, pages) })
+}
+
+// dotOutput renders the link graph (parent -> child edges recorded during
+// BFS) as a Graphviz digraph.
+type dotOutput struct{}
+
+func (dotOutput) writeTo(w io.Writer, pages []page) error {
+	if _, err := fmt.Fprintln(w, "digraph sitemap {"); err != nil {
+		return err
+	}
+	for _, p := range pages {
+		if p.Parent == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "  %q -> %q;\n", p.Parent, p.URL); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+func (o dotOutput) Write(outPath string, pages []page) error {
+	return withOutput(outPath, func(w io.Writer) error { return o.writeTo(w, pages) })
+}
+
+// sitemapref/sitemapindex mirror loc/urlset's naming so the Go type name
+// doubles as the XML element name without an explicit XMLName field.
+type sitemapref struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapindex struct {
+	Sitemaps []sitemapref `xml:"sitemap"`
+	Xmlns    string       `xml:"xmlns,attr"`
+}
+
+// sitemapIndexOutput auto-splits pages across multiple gzipped <base>-N.xml.gz
+// files, where <base> is -out's file name minus its extension (so -out
+// sitemap.xml yields sitemap-1.xml.gz, ...), per the sitemaps.org size
+// limits, and writes a top-level
+// sitemapindex pointing at them. Because it writes several files, it
+// requires -out to be set -- stdout can't hold more than one file.
+type sitemapIndexOutput struct {
+	changeFreqOverride string
+}
+
+func (o sitemapIndexOutput) Write(outPath string, pages []page) error {
+	if outPath == "" {
+		return fmt.Errorf("-format sitemapindex writes multiple files and requires -out")
+	}
+
+	chunks := chunkPages(pages)
+
+	dir := filepath.Dir(outPath)
+	base := strings.TrimSuffix(filepath.Base(outPath), filepath.Ext(outPath))
+
+	names := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		name := fmt.Sprintf("%s-%d.xml.gz", base, i+1)
+		inner := gzipOutput{inner: xmlOutput{changeFreqOverride: o.changeFreqOverride}}
+		if err := inner.Write(filepath.Join(dir, name), chunk); err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	return withOutput(outPath, func(w io.Writer) error {
+		idx := sitemapindex{Xmlns: xmlns}
+		for _, name := range names {
+			idx.Sitemaps = append(idx.Sitemaps, sitemapref{Loc: name})
+		}
+		if _, err := fmt.Fprint(w, xml.Header); err != nil {
+			return err
+		}
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "   ")
+		return enc.Encode(idx)
+	})
+}
+
+// entryOverheadBytes estimates the non-<loc> bytes in a single <url> entry:
+// the <url>/<loc> tags plus a <lastmod>, <changefreq>, and <priority> each
+// sized for their typical rendered length (e.g. "2006-01-02T15:04:05Z07:00",
+// "monthly", "0.8").
+const entryOverheadBytes = len("<url><loc></loc>\n") +
+	len("<lastmod></lastmod>\n") + len("2006-01-02T15:04:05Z07:00") +
+	len("<changefreq></changefreq>\n") + len("monthly") +
+	len("<priority></priority>\n") + len("0.8") +
+	len("</url>\n")
+
+// chunkPages splits pages into groups obeying the sitemaps.org per-file
+// limits: at most 50,000 URLs, and an approximate 50 MiB uncompressed size
+// (estimated from URL length plus the <lastmod>/<changefreq>/<priority>
+// fields every entry now carries, since together those dominate an entry's size).
+func chunkPages(pages []page) [][]page {
+	var chunks [][]page
+	var cur []page
+	var curBytes int
+
+	for _, p := range pages {
+		entryBytes := len(p.URL) + entryOverheadBytes
+		if len(cur) > 0 && (len(cur) >= maxURLsPerSitemap || curBytes+entryBytes > maxSitemapBytes) {
+			chunks = append(chunks, cur)
+			cur = nil
+			curBytes = 0
+		}
+		cur = append(cur, p)
+		curBytes += entryBytes
+	}
+	if len(cur) > 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
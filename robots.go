@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// errDisallowed is returned by fetch when robots.txt forbids the URL.
+var errDisallowed = errors.New("disallowed by robots.txt")
+
+// errUnwantedContent is returned by precheck when a HEAD response's
+// Content-Type isn't HTML or its Content-Length exceeds maxBodyBytes.
+var errUnwantedContent = errors.New("content type or length not eligible for crawling")
+
+// robotsCache fetches and caches robots.txt per host, honoring Disallow and
+// Crawl-delay directives. Once a host's robots.txt is cached it is reused;
+// workers that look up a host before its first fetch completes each fetch it.
+type robotsCache struct {
+	client *http.Client
+	ua     string
+
+	mu     sync.Mutex
+	byHost map[string]*robotstxt.RobotsData
+}
+
+func newRobotsCache(client *http.Client, ua string) *robotsCache {
+	return &robotsCache{
+		client: client,
+		ua:     ua,
+		byHost: make(map[string]*robotstxt.RobotsData),
+	}
+}
+
+// allowed reports whether urlStr may be fetched, along with any Crawl-delay
+// the host's robots.txt requests (0 if none).
+func (r *robotsCache) allowed(urlStr string) (bool, time.Duration) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return true, 0
+	}
+	data := r.get(u)
+	if data == nil {
+		return true, 0
+	}
+	group := data.FindGroup(r.ua)
+	return group.Test(u.Path), group.CrawlDelay
+}
+
+// get returns the cached robots.txt for u's host, fetching it on first use.
+func (r *robotsCache) get(u *url.URL) *robotstxt.RobotsData {
+	host := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+
+	r.mu.Lock()
+	data, ok := r.byHost[host]
+	r.mu.Unlock()
+	if ok {
+		return data
+	}
+
+	data = r.fetch(host)
+
+	r.mu.Lock()
+	r.byHost[host] = data
+	r.mu.Unlock()
+	return data
+}
+
+// fetch downloads host+"/robots.txt". A fetch/parse failure is treated as
+// "no restrictions" rather than blocking the crawl.
+func (r *robotsCache) fetch(host string) *robotstxt.RobotsData {
+	req, err := http.NewRequest(http.MethodGet, host+"/robots.txt", nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", r.ua)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	data, err := robotstxt.FromResponse(resp)
+	if err != nil {
+		return nil
+	}
+	return data
+}